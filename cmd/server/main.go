@@ -6,52 +6,106 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/PrunesLand/eeg-server.git/internal/api"
+	"github.com/PrunesLand/eeg-server.git/internal/dsp"
+	"github.com/PrunesLand/eeg-server.git/internal/recorder"
 	"github.com/PrunesLand/eeg-server.git/internal/serial"
 	"github.com/PrunesLand/eeg-server.git/internal/settings"
 )
 
-func main() {
-	fmt.Println("🧠 EEG Server Starting...")
-
-	// 0. Initialize Settings & API
-	appSettings := settings.New()
-	go api.StartServer(appSettings)
-
-	// 1. List Ports
-	ports, err := serial.ListPorts()
-	if err != nil {
-		log.Fatalf("Failed to list ports: %v", err)
+// allowedOrigins returns the CORS/WS origin allowlist from the
+// comma-separated EEG_ALLOWED_ORIGINS env var, or nil (no cross-origin
+// access) if it's unset.
+func allowedOrigins() []string {
+	raw := os.Getenv("EEG_ALLOWED_ORIGINS")
+	if raw == "" {
+		return nil
 	}
 
-	if len(ports) == 0 {
-		fmt.Println("No serial ports found!")
-		fmt.Println("Available ports logic: (mocking if none found for testing could be added here)")
-		// For now, valid to just exit or ask user to check connection
-		return
+	var origins []string
+	for _, o := range strings.Split(raw, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
 	}
+	return origins
+}
 
-	fmt.Println("Available Ports:")
-	for i, p := range ports {
-		fmt.Printf(" [%d] %s\n", i, p)
+// recordingFormat returns the on-disk recording format selected by
+// EEG_RECORDING_FORMAT ("bin" or "csv"), defaulting to recorder.FormatBinary.
+func recordingFormat() recorder.Format {
+	if recorder.Format(os.Getenv("EEG_RECORDING_FORMAT")) == recorder.FormatCSV {
+		return recorder.FormatCSV
 	}
+	return recorder.FormatBinary
+}
 
-	// Simple selection: Pick the first one for now, or let user type?
-	// For "one-shot" allow testing, let's pick the first one automatically or use a hardcoded default if preferred.
-	// But let's ask user to confirm if we want to be fancy. For now, simple: use the first one.
-	selectedPort := serial.FindPreferredPort(ports)
+func main() {
+	fmt.Println("🧠 EEG Server Starting...")
 
-	// Check for manual override
-	if len(os.Args) > 1 && os.Args[1] == "mock" {
+	// 0. Initialize Settings, the sample fanout, the DSP filter chain, and the recorder
+	appSettings := settings.New()
+	hub := dsp.NewHub()
+	initialConfig := appSettings.GetConfig()
+	filter := dsp.NewFilter(initialConfig.Filter, initialConfig.SampleRate)
+	rec := recorder.New(hub, "./recordings", recordingFormat(), appSettings.GetGain)
+
+	// 1. Select a port. `mock` and `replay <file> [speed]` are manual
+	// overrides for developing and testing without hardware attached; with
+	// neither, fall back to listing real ports and auto-selecting one.
+	var selectedPort, replayFile string
+	var replaySpeed float64
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == "mock":
 		fmt.Println("⚠️ Manual override: Switching to MOCK MODE.")
 		selectedPort = serial.PortMock
-	} else if selectedPort == "" {
-		fmt.Println("⚠️ No 'usbmodem' or 'usbserial' found. Switching to MOCK MODE.")
-		selectedPort = serial.PortMock
-	} else {
-		fmt.Printf("✅ Auto-selected Port: %s\n", selectedPort)
+
+	case len(os.Args) > 1 && os.Args[1] == "replay":
+		if len(os.Args) < 3 {
+			log.Fatal("usage: go run ./cmd/server replay <file> [speed]")
+		}
+		fmt.Printf("⚠️ Manual override: Replaying %s\n", os.Args[2])
+		selectedPort = serial.PortReplay
+		replayFile = os.Args[2]
+		if len(os.Args) > 3 {
+			speed, err := strconv.ParseFloat(os.Args[3], 64)
+			if err != nil {
+				log.Fatalf("invalid replay speed %q: %v", os.Args[3], err)
+			}
+			replaySpeed = speed
+		}
+
+	default:
+		ports, err := serial.ListPorts()
+		if err != nil {
+			log.Fatalf("Failed to list ports: %v", err)
+		}
+
+		if len(ports) == 0 {
+			fmt.Println("⚠️ No serial ports found. Switching to MOCK MODE.")
+			selectedPort = serial.PortMock
+			break
+		}
+
+		fmt.Println("Available Ports:")
+		for i, p := range ports {
+			fmt.Printf(" [%d] %s\n", i, p)
+		}
+
+		// Simple selection: Pick the first one for now, or let user type?
+		// For "one-shot" allow testing, let's pick the first one automatically or use a hardcoded default if preferred.
+		// But let's ask user to confirm if we want to be fancy. For now, simple: use the first one.
+		selectedPort = serial.FindPreferredPort(ports)
+		if selectedPort == "" {
+			fmt.Println("⚠️ No 'usbmodem' or 'usbserial' found. Switching to MOCK MODE.")
+			selectedPort = serial.PortMock
+		} else {
+			fmt.Printf("✅ Auto-selected Port: %s\n", selectedPort)
+		}
 	}
 
 	// 2. Start Connection
@@ -70,6 +124,26 @@ func main() {
 
 	baudRate := 2086956 // baud rate of the eeg device
 	device := serial.New(selectedPort, baudRate)
+	device.ReplayFile = replayFile
+	device.ReplaySpeed = replaySpeed
+
+	// API server config. TLS and auth are secure by default: a self-signed
+	// cert and a random auth token are generated into DataDir on first run
+	// unless EEG_TLS_DISABLED or EEG_AUTH_DISABLED opt out, for local
+	// development. EEG_AUTH_TOKEN pins the token instead of generating one,
+	// and EEG_ALLOWED_ORIGINS opts specific browser origins into CORS/WS
+	// (unset allows none; "*" allows any).
+	apiConfig := api.Config{
+		Addr:           ":8080",
+		TLSDisabled:    os.Getenv("EEG_TLS_DISABLED") != "",
+		DataDir:        "./data",
+		AuthToken:      os.Getenv("EEG_AUTH_TOKEN"),
+		AuthDisabled:   os.Getenv("EEG_AUTH_DISABLED") != "",
+		AllowedOrigins: allowedOrigins(),
+	}
+
+	// The API needs the device for /api/device, so start it now that we have one.
+	go api.StartServer(apiConfig, appSettings, hub, rec, device, filter)
 
 	fmt.Printf("Connecting to %s at %d baud...\n", selectedPort, baudRate)
 	if err := device.Start(ctx); err != nil {
@@ -79,52 +153,25 @@ func main() {
 	// 3. Read Data
 	fmt.Println("Listening for data... (Press Ctrl+C to stop)")
 
-	// Create a parser
-	go func() {
-		for packet := range device.DataStream {
-			if len(packet) != 25 {
-				log.Printf("⚠️ Invalid packet length: %d", len(packet))
-				continue
-			}
+	// Parse packets, run them through the DSP filter chain, and fan the
+	// resulting samples out so the WS layer, recorder, and console printer
+	// below can all subscribe independently: serial -> parse -> DSP -> fanout.
+	go hub.Run(device.DataStream, device.ReleaseBatch, filter)
 
-			if packet[0] != 'A' {
-				log.Printf("⚠️ Invalid header: %02x", packet[0])
-				continue
-			}
+	// Console printer: just another hub subscriber.
+	go func() {
+		samples, unsubscribe := hub.Subscribe(32)
+		defer unsubscribe()
 
-			// Get current gain dynamically
-			currentGain := appSettings.GetGain()
-			// Constant Scale Factor = Vref / (2^24)
-			// Voltage = (Raw * Scale) / Gain
-			const vRef = 5.0
-			const maxADC = 16777216.0 // 2^24
-			scale := vRef / maxADC
+		for sample := range samples {
+			cfg := appSettings.GetConfig()
 
-			// Parse 8 channels
 			fmt.Print("RX: ")
 			for ch := 0; ch < 8; ch++ {
-				// 3 bytes per channel (Big Endian)
-				start := 1 + (ch * 3)
-				b0 := packet[start]
-				b1 := packet[start+1]
-				b2 := packet[start+2]
-
-				// Reassemble 24-bit Int
-				// uint32 first to shift
-				val32 := uint32(b0)<<16 | uint32(b1)<<8 | uint32(b2)
-
-				// Sign extension for 24-bit to 32-bit
-				if val32&0x800000 != 0 {
-					val32 |= 0xFF000000
+				if !cfg.ChannelEnable[ch] {
+					continue
 				}
-
-				// Convert to signed int in Go
-				valSigned := int32(val32)
-
-				// Apply Conversion Formula
-				// volts = (raw * 5.0) / (2^24 * gain)
-				volts := (float64(valSigned) * scale) / currentGain
-
+				volts := dsp.Volts(sample.Channels[ch], cfg.ChannelGain[ch])
 				fmt.Printf("[%d]: %10.6f V  ", ch+1, volts)
 			}
 			fmt.Println()
@@ -1,19 +1,34 @@
 package api
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/gorilla/websocket"
+
+	"github.com/PrunesLand/eeg-server.git/internal/dsp"
+	"github.com/PrunesLand/eeg-server.git/internal/recorder"
+	"github.com/PrunesLand/eeg-server.git/internal/serial"
 	"github.com/PrunesLand/eeg-server.git/internal/settings"
 )
 
-// StartServer starts the HTTP API server in a background goroutine.
-func StartServer(s *settings.Settings) {
+// StartServer starts the HTTP API server in a background goroutine,
+// according to cfg (see Config). hub is the live sample fanout that the WS
+// stream endpoint subscribes to. rec controls the on-disk session
+// recording. dev exposes the serial connection state for /api/device.
+// filter is reconfigured whenever /api/dsp changes the filter chain.
+func StartServer(cfg Config, s *settings.Settings, hub *dsp.Hub, rec *recorder.Recorder, dev *serial.Device, filter *dsp.Filter) {
+	cfg.AuthToken = resolveAuthToken(cfg)
+
 	mux := http.NewServeMux()
 
 	// GET/POST /api/gain
-	mux.HandleFunc("/api/gain", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/gain", requireAuth(cfg.AuthToken, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			handleGetGain(w, r, s)
@@ -22,12 +37,85 @@ func StartServer(s *settings.Settings) {
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
+	}))
+
+	// GET/POST /api/dsp - read or atomically swap the full DSP configuration.
+	mux.HandleFunc("/api/dsp", requireAuth(cfg.AuthToken, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handleGetDSP(w, r, s)
+		case http.MethodPost:
+			handleSetDSP(w, r, s, filter)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	// GET /ws/stream - live sample stream for browser/console consumers.
+	upgrader := newUpgrader(cfg.AllowedOrigins)
+	mux.HandleFunc("/ws/stream", func(w http.ResponseWriter, r *http.Request) {
+		handleWSStream(w, r, s, hub, upgrader, cfg.AuthToken)
 	})
 
-	log.Println("🌍 API Server listening on :8080")
-	if err := http.ListenAndServe(":8080", mux); err != nil {
-		log.Fatalf("API Server failed: %v", err)
+	// POST /api/recording/start, /stop and GET /api/recording/status.
+	mux.HandleFunc("/api/recording/start", requireAuth(cfg.AuthToken, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := rec.Start(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeRecordingStatus(w, rec)
+	}))
+	mux.HandleFunc("/api/recording/stop", requireAuth(cfg.AuthToken, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := rec.Stop(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeRecordingStatus(w, rec)
+	}))
+	mux.HandleFunc("/api/recording/status", requireAuth(cfg.AuthToken, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeRecordingStatus(w, rec)
+	}))
+
+	// GET /api/device - current port, baud, connection state, and dropped
+	// batch count.
+	mux.HandleFunc("/api/device", requireAuth(cfg.AuthToken, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		response := map[string]interface{}{
+			"port":           dev.CurrentPort(),
+			"baud":           dev.BaudRate,
+			"state":          dev.CurrentState().String(),
+			"droppedBatches": dev.DroppedBatches(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+
+	serve(cfg, withCORS(cfg.AllowedOrigins, mux))
+}
+
+func writeRecordingStatus(w http.ResponseWriter, rec *recorder.Recorder) {
+	recording, path := rec.Status()
+	response := map[string]interface{}{
+		"recording": recording,
+		"file":      path,
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 func handleGetGain(w http.ResponseWriter, r *http.Request, s *settings.Settings) {
@@ -64,3 +152,173 @@ func handleSetGain(w http.ResponseWriter, r *http.Request, s *settings.Settings)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+func handleGetDSP(w http.ResponseWriter, r *http.Request, s *settings.Settings) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.GetConfig())
+}
+
+func handleSetDSP(w http.ResponseWriter, r *http.Request, s *settings.Settings, filter *dsp.Filter) {
+	var cfg settings.Config
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateDSPConfig(cfg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.SetConfig(cfg)
+	filter.Reconfigure(cfg.Filter, cfg.SampleRate)
+	log.Println("🎛️ DSP configuration updated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.GetConfig())
+}
+
+// validateDSPConfig rejects values that would silently corrupt the filter
+// chain or its output: a zero/negative sample rate and notch Q produce NaN
+// biquad coefficients, and a zero channel gain divides by zero in dsp.Volts.
+// /api/dsp is an atomic swap of the whole config, so every field is checked
+// even if the caller only meant to touch one sub-object.
+func validateDSPConfig(cfg settings.Config) error {
+	if cfg.SampleRate <= 0 {
+		return fmt.Errorf("sampleRate must be > 0")
+	}
+	if cfg.Filter.NotchFreq > 0 && cfg.Filter.NotchQ <= 0 {
+		return fmt.Errorf("notchQ must be > 0 when notchFreq is set")
+	}
+	for ch, gain := range cfg.ChannelGain {
+		if gain == 0 {
+			return fmt.Errorf("channelGain[%d] cannot be 0", ch)
+		}
+	}
+	return nil
+}
+
+// wsStreamParams holds the per-connection options parsed from the query
+// string of a /ws/stream request.
+type wsStreamParams struct {
+	volts       bool  // format=volts (default raw int32)
+	binary      bool  // encoding=binary (default json)
+	channelMask uint8 // channels=0x03 style bitmask, default all 8
+	downsample  int   // downsample=N, keep 1 in every N samples, default 1
+}
+
+func parseWSStreamParams(r *http.Request) wsStreamParams {
+	q := r.URL.Query()
+	p := wsStreamParams{
+		channelMask: 0xFF,
+		downsample:  1,
+	}
+
+	if q.Get("format") == "volts" {
+		p.volts = true
+	}
+	if q.Get("encoding") == "binary" {
+		p.binary = true
+	}
+	if maskStr := q.Get("channels"); maskStr != "" {
+		if mask, err := strconv.ParseUint(maskStr, 0, 8); err == nil {
+			p.channelMask = uint8(mask)
+		}
+	}
+	if dsStr := q.Get("downsample"); dsStr != "" {
+		if n, err := strconv.Atoi(dsStr); err == nil && n > 0 {
+			p.downsample = n
+		}
+	}
+	return p
+}
+
+// handleWSStream upgrades the connection and streams parsed samples to the
+// client until they disconnect or the hub closes. Unlike the REST endpoints,
+// a WS upgrade is always a GET, so it can't go through requireAuth's
+// header-based middleware; browsers also can't set custom headers on the
+// WebSocket handshake, so the token may be supplied either way.
+func handleWSStream(w http.ResponseWriter, r *http.Request, s *settings.Settings, hub *dsp.Hub, upgrader websocket.Upgrader, authToken string) {
+	if !wsAuthorized(r, authToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("⚠️ WS upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	params := parseWSStreamParams(r)
+	samples, unsubscribe := hub.Subscribe(32)
+	defer unsubscribe()
+
+	log.Printf("🔗 WS client connected: %s", conn.RemoteAddr())
+
+	count := 0
+	for sample := range samples {
+		count++
+		if count%params.downsample != 0 {
+			continue
+		}
+
+		cfg := s.GetConfig()
+		var writeErr error
+		if params.binary {
+			writeErr = writeBinaryFrame(conn, sample, cfg, params)
+		} else {
+			writeErr = writeJSONFrame(conn, sample, cfg, params)
+		}
+		if writeErr != nil {
+			log.Printf("🔗 WS client disconnected: %v", writeErr)
+			return
+		}
+	}
+}
+
+// wsSampleJSON is the JSON framing for one sample, browser-friendly.
+type wsSampleJSON struct {
+	Raw   []int32   `json:"raw,omitempty"`
+	Volts []float64 `json:"volts,omitempty"`
+}
+
+func writeJSONFrame(conn *websocket.Conn, sample dsp.Sample, cfg settings.Config, p wsStreamParams) error {
+	var msg wsSampleJSON
+	for ch := 0; ch < 8; ch++ {
+		if p.channelMask&(1<<uint(ch)) == 0 || !cfg.ChannelEnable[ch] {
+			continue
+		}
+		if p.volts {
+			msg.Volts = append(msg.Volts, dsp.Volts(sample.Channels[ch], cfg.ChannelGain[ch]))
+		} else {
+			msg.Raw = append(msg.Raw, sample.Channels[ch])
+		}
+	}
+	return conn.WriteJSON(msg)
+}
+
+// writeBinaryFrame encodes the selected channels as a little-endian float32
+// vector, which is cheaper for a browser to decode at 250 Hz / 8 channels
+// than parsing JSON.
+func writeBinaryFrame(conn *websocket.Conn, sample dsp.Sample, cfg settings.Config, p wsStreamParams) error {
+	buf := make([]byte, 0, 8*4)
+	for ch := 0; ch < 8; ch++ {
+		if p.channelMask&(1<<uint(ch)) == 0 || !cfg.ChannelEnable[ch] {
+			continue
+		}
+
+		var v float32
+		if p.volts {
+			v = float32(dsp.Volts(sample.Channels[ch], cfg.ChannelGain[ch]))
+		} else {
+			v = float32(sample.Channels[ch])
+		}
+
+		var bits [4]byte
+		binary.LittleEndian.PutUint32(bits[:], math.Float32bits(v))
+		buf = append(buf, bits[:]...)
+	}
+	return conn.WriteMessage(websocket.BinaryMessage, buf)
+}
@@ -0,0 +1,301 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Config configures StartServer: the listen address, TLS material, bearer
+// auth, and CORS.
+type Config struct {
+	// Addr is the address to listen on, e.g. ":8080".
+	Addr string
+
+	// TLSDisabled serves plain HTTP, for local development. When false
+	// (the default), TLSCertFile/TLSKeyFile are used if set, otherwise a
+	// self-signed certificate is generated into DataDir.
+	TLSDisabled bool
+	TLSCertFile string
+	TLSKeyFile  string
+	// DataDir is where an auto-generated self-signed cert/key are stored
+	// (and reused on restart). Defaults to "." if empty.
+	DataDir string
+
+	// AuthToken, if non-empty, is required as a bearer token on every REST
+	// endpoint and on the /ws/stream upgrade. If empty and AuthDisabled is
+	// false (the default), StartServer generates a random token and
+	// persists it in DataDir the same way it does a self-signed cert, so
+	// auth is on by default without any configuration.
+	AuthToken string
+	// AuthDisabled opts out of the auto-generated token above, leaving the
+	// API unauthenticated. Only meant for local development.
+	AuthDisabled bool
+
+	// AllowedOrigins is the CORS allowlist, also used to validate the
+	// Origin header on WS upgrades. "*" allows any origin. Empty (the
+	// default) disallows cross-origin requests entirely.
+	AllowedOrigins []string
+}
+
+// serve starts the HTTP server described by cfg, blocking until it exits.
+func serve(cfg Config, handler http.Handler) {
+	addr := cfg.Addr
+	if addr == "" {
+		addr = ":8080"
+	}
+
+	if cfg.TLSDisabled {
+		log.Printf("🌍 API Server listening on %s (TLS disabled)", addr)
+		if err := http.ListenAndServe(addr, handler); err != nil {
+			log.Fatalf("API Server failed: %v", err)
+		}
+		return
+	}
+
+	certFile, keyFile := cfg.TLSCertFile, cfg.TLSKeyFile
+	if certFile == "" || keyFile == "" {
+		dataDir := cfg.DataDir
+		if dataDir == "" {
+			dataDir = "."
+		}
+		var err error
+		certFile, keyFile, err = ensureSelfSignedCert(dataDir)
+		if err != nil {
+			log.Fatalf("Failed to prepare TLS certificate: %v", err)
+		}
+	}
+
+	log.Printf("🌍 API Server listening on %s (TLS)", addr)
+	if err := http.ListenAndServeTLS(addr, certFile, keyFile, handler); err != nil {
+		log.Fatalf("API Server failed: %v", err)
+	}
+}
+
+// requireAuth wraps next so that every request, including reads like
+// /api/device or /api/dsp GET, must carry a matching
+// `Authorization: Bearer <token>` header; CORS preflight OPTIONS requests
+// never reach next since withCORS answers them directly. An empty token
+// disables the check, for local development.
+func requireAuth(token string, next http.HandlerFunc) http.HandlerFunc {
+	if token == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !bearerMatches(r.Header.Get("Authorization"), token) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// wsAuthorized checks the bearer token for the /ws/stream upgrade. Since
+// browsers can't set custom headers on a WebSocket handshake, it also
+// accepts the token as a ?token= query parameter. An empty authToken
+// disables the check.
+func wsAuthorized(r *http.Request, authToken string) bool {
+	if authToken == "" {
+		return true
+	}
+	if bearerMatches(r.Header.Get("Authorization"), authToken) {
+		return true
+	}
+	return tokensEqual(r.URL.Query().Get("token"), authToken)
+}
+
+func bearerMatches(header, token string) bool {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	return tokensEqual(strings.TrimPrefix(header, prefix), token)
+}
+
+// tokensEqual compares a and b in constant time so a failed match can't leak
+// how many leading bytes of the token a guess got right.
+func tokensEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// withCORS wraps next with CORS headers for the configured origin allowlist,
+// answering preflight OPTIONS requests directly.
+func withCORS(allowed []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && originAllowed(origin, allowed) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Vary", "Origin")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		}
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func originAllowed(origin string, allowed []string) bool {
+	for _, o := range allowed {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// newUpgrader builds a websocket.Upgrader whose CheckOrigin enforces the
+// same allowlist as withCORS.
+func newUpgrader(allowed []string) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			return originAllowed(origin, allowed)
+		},
+	}
+}
+
+// ensureSelfSignedCert returns a cert/key pair in dataDir, generating a
+// fresh ECDSA self-signed certificate the first time it's called so later
+// runs reuse the same identity.
+func ensureSelfSignedCert(dataDir string) (certFile, keyFile string, err error) {
+	certFile = filepath.Join(dataDir, "server.crt")
+	keyFile = filepath.Join(dataDir, "server.key")
+
+	if _, err := os.Stat(certFile); err == nil {
+		if _, err := os.Stat(keyFile); err == nil {
+			return certFile, keyFile, nil
+		}
+	}
+
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return "", "", err
+	}
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"eeg-server"}, CommonName: "localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		return "", "", err
+	}
+
+	certOut, err := os.Create(certFile)
+	if err != nil {
+		return "", "", err
+	}
+	defer certOut.Close()
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		return "", "", err
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		return "", "", err
+	}
+	keyOut, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", "", err
+	}
+	defer keyOut.Close()
+	if err := pem.Encode(keyOut, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}); err != nil {
+		return "", "", err
+	}
+
+	log.Printf("🔐 Generated self-signed TLS certificate at %s", certFile)
+	return certFile, keyFile, nil
+}
+
+// resolveAuthToken returns the bearer token StartServer should require,
+// applying Config's secure-by-default policy: an explicit AuthToken wins,
+// AuthDisabled opts out entirely, and otherwise a token is generated and
+// persisted in DataDir (see ensureAuthToken) so the API isn't reachable
+// without one out of the box.
+func resolveAuthToken(cfg Config) string {
+	if cfg.AuthToken != "" || cfg.AuthDisabled {
+		return cfg.AuthToken
+	}
+
+	dataDir := cfg.DataDir
+	if dataDir == "" {
+		dataDir = "."
+	}
+	token, err := ensureAuthToken(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to prepare auth token: %v", err)
+	}
+	return token
+}
+
+// ensureAuthToken returns a bearer token stored in dataDir, generating and
+// persisting a random one the first time it's called so later runs keep
+// requiring the same token, the same way ensureSelfSignedCert reuses its
+// certificate across restarts.
+func ensureAuthToken(dataDir string) (string, error) {
+	tokenFile := filepath.Join(dataDir, "auth.token")
+
+	if b, err := os.ReadFile(tokenFile); err == nil {
+		if token := strings.TrimSpace(string(b)); token != "" {
+			return token, nil
+		}
+		log.Printf("⚠️ %s exists but is empty; regenerating auth token", tokenFile)
+	}
+
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+
+	if err := os.WriteFile(tokenFile, []byte(token), 0o600); err != nil {
+		return "", err
+	}
+
+	log.Printf("🔑 Generated API auth token, stored at %s", tokenFile)
+	return token, nil
+}
@@ -0,0 +1,183 @@
+// Package dsp decodes raw serial packets into samples and fans them out to
+// any number of subscribers (the WS handler, the console printer, future
+// recorders, ...) without letting a slow subscriber steal packets from the
+// others.
+package dsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Sample is one decoded frame: 8 channels of sign-extended 24-bit ADC values.
+type Sample struct {
+	Channels [8]int32
+}
+
+// Parse decodes a raw 25-byte serial packet into a Sample.
+// Packet layout: ['A'] [3-byte BE signed ch1] ... [3-byte BE signed ch8].
+func Parse(packet []byte) (Sample, bool) {
+	var s Sample
+	if len(packet) != 25 || packet[0] != 'A' {
+		return s, false
+	}
+
+	for ch := 0; ch < 8; ch++ {
+		// 3 bytes per channel (Big Endian)
+		start := 1 + (ch * 3)
+		b0 := packet[start]
+		b1 := packet[start+1]
+		b2 := packet[start+2]
+
+		// Reassemble 24-bit Int, then sign-extend to 32-bit.
+		val32 := uint32(b0)<<16 | uint32(b1)<<8 | uint32(b2)
+		if val32&0x800000 != 0 {
+			val32 |= 0xFF000000
+		}
+		s.Channels[ch] = int32(val32)
+	}
+	return s, true
+}
+
+// Encode re-serializes a Sample back into a 25-byte wire packet, the inverse
+// of Parse. Used by the mock generator and by serial.PortReplay to feed
+// recorded samples back through the normal Device pipeline.
+func Encode(s Sample) []byte {
+	packet := make([]byte, 25)
+	packet[0] = 'A'
+	for ch := 0; ch < 8; ch++ {
+		start := 1 + (ch * 3)
+		v := s.Channels[ch]
+		packet[start] = byte((v >> 16) & 0xFF)
+		packet[start+1] = byte((v >> 8) & 0xFF)
+		packet[start+2] = byte(v & 0xFF)
+	}
+	return packet
+}
+
+// Volts converts a raw ADC channel value to volts for the given gain.
+// volts = (raw * 5.0) / (2^24 * gain)
+func Volts(raw int32, gain float64) float64 {
+	const vRef = 5.0
+	const maxADC = 16777216.0 // 2^24
+	scale := vRef / maxADC
+	return (float64(raw) * scale) / gain
+}
+
+// BinaryMagic identifies files written in the binary session framing used by
+// internal/recorder and read back by serial.PortReplay.
+var BinaryMagic = [4]byte{'E', 'E', 'G', 'R'}
+
+// WriteBinaryHeader writes the fixed header (magic + gain) at the start of a
+// binary recording.
+func WriteBinaryHeader(w io.Writer, gain float64) error {
+	if _, err := w.Write(BinaryMagic[:]); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, gain)
+}
+
+// ReadBinaryHeader reads and validates the header written by
+// WriteBinaryHeader, returning the gain the recording was made at.
+func ReadBinaryHeader(r io.Reader) (gain float64, err error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return 0, err
+	}
+	if magic != BinaryMagic {
+		return 0, fmt.Errorf("dsp: bad binary recording magic %q", magic)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &gain); err != nil {
+		return 0, err
+	}
+	return gain, nil
+}
+
+// WriteBinarySample appends one sample's channels to a binary recording.
+func WriteBinarySample(w io.Writer, s Sample) error {
+	return binary.Write(w, binary.LittleEndian, s.Channels)
+}
+
+// ReadBinarySample reads one sample back; it returns io.EOF once the
+// recording is exhausted.
+func ReadBinarySample(r io.Reader) (Sample, error) {
+	var s Sample
+	if err := binary.Read(r, binary.LittleEndian, &s.Channels); err != nil {
+		return Sample{}, err
+	}
+	return s, nil
+}
+
+// Hub fans out parsed samples from a single producer to many subscribers.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[chan Sample]struct{}
+}
+
+// NewHub creates an empty Hub.
+func NewHub() *Hub {
+	return &Hub{
+		subs: make(map[chan Sample]struct{}),
+	}
+}
+
+// Subscribe registers a new consumer and returns a buffered channel of
+// samples plus an unsubscribe func that must be called when the consumer is
+// done. Subscribers that fall behind have samples dropped rather than
+// blocking the fanout or other subscribers.
+func (h *Hub) Subscribe(buffer int) (<-chan Sample, func()) {
+	ch := make(chan Sample, buffer)
+
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+		h.mu.Unlock()
+	}
+	return ch, unsubscribe
+}
+
+// Run parses every packet in every batch from in, runs it through filter
+// (serial -> parse -> DSP -> fanout), and broadcasts the result to all
+// current subscribers. It returns once in is closed. If release is
+// non-nil, it is called with each batch once every packet in it has been
+// parsed, so the producer can return it to a pool. filter may be nil to
+// skip DSP processing.
+func (h *Hub) Run(in <-chan [][]byte, release func([][]byte), filter *Filter) {
+	for batch := range in {
+		for _, packet := range batch {
+			sample, ok := Parse(packet)
+			if !ok {
+				continue
+			}
+			if filter != nil {
+				sample = filter.Process(sample)
+			}
+			h.broadcast(sample)
+		}
+		if release != nil {
+			release(batch)
+		}
+	}
+}
+
+func (h *Hub) broadcast(s Sample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- s:
+		default:
+			// Slow subscriber: drop this sample for them rather than block
+			// the fanout or the other subscribers.
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package dsp
+
+import (
+	"math"
+	"sync"
+
+	"github.com/PrunesLand/eeg-server.git/internal/settings"
+)
+
+// defaultQ is the Butterworth Q factor used for the bandpass sections.
+const defaultQ = 0.70710678
+
+// Biquad is one second-order IIR section, evaluated in Direct Form II
+// Transposed so only two state variables are needed per instance.
+type Biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+	z1, z2     float64
+}
+
+// Process filters one sample through the section.
+func (b *Biquad) Process(x float64) float64 {
+	y := b.b0*x + b.z1
+	b.z1 = b.b1*x - b.a1*y + b.z2
+	b.z2 = b.b2*x - b.a2*y
+	return y
+}
+
+// Reset clears the section's state, e.g. after its coefficients change.
+func (b *Biquad) Reset() {
+	b.z1, b.z2 = 0, 0
+}
+
+// NotchCoeffs computes RBJ audio-EQ-cookbook notch coefficients to reject
+// freq (typically 50 or 60 Hz mains hum) at the given Q and sample rate.
+func NotchCoeffs(freq, q, sampleRate float64) Biquad {
+	w0 := 2 * math.Pi * freq / sampleRate
+	alpha := math.Sin(w0) / (2 * q)
+	cosw0 := math.Cos(w0)
+
+	a0 := 1 + alpha
+	return Biquad{
+		b0: 1 / a0,
+		b1: -2 * cosw0 / a0,
+		b2: 1 / a0,
+		a1: -2 * cosw0 / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+// HighpassCoeffs computes RBJ audio-EQ-cookbook highpass coefficients.
+func HighpassCoeffs(freq, q, sampleRate float64) Biquad {
+	w0 := 2 * math.Pi * freq / sampleRate
+	alpha := math.Sin(w0) / (2 * q)
+	cosw0 := math.Cos(w0)
+
+	a0 := 1 + alpha
+	return Biquad{
+		b0: (1 + cosw0) / 2 / a0,
+		b1: -(1 + cosw0) / a0,
+		b2: (1 + cosw0) / 2 / a0,
+		a1: -2 * cosw0 / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+// LowpassCoeffs computes RBJ audio-EQ-cookbook lowpass coefficients.
+func LowpassCoeffs(freq, q, sampleRate float64) Biquad {
+	w0 := 2 * math.Pi * freq / sampleRate
+	alpha := math.Sin(w0) / (2 * q)
+	cosw0 := math.Cos(w0)
+
+	a0 := 1 + alpha
+	return Biquad{
+		b0: (1 - cosw0) / 2 / a0,
+		b1: (1 - cosw0) / a0,
+		b2: (1 - cosw0) / 2 / a0,
+		a1: -2 * cosw0 / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+// Chain is a cascade of biquad stages applied to one channel, in the order
+// they were added: notch, then highpass (low cutoff), then lowpass (high
+// cutoff).
+type Chain struct {
+	stages []*Biquad
+}
+
+// NewChain builds the stage cascade described by cfg for the given sample
+// rate.
+func NewChain(cfg settings.FilterConfig, sampleRate float64) *Chain {
+	var stages []*Biquad
+
+	if cfg.NotchFreq > 0 {
+		bq := NotchCoeffs(cfg.NotchFreq, cfg.NotchQ, sampleRate)
+		stages = append(stages, &bq)
+	}
+
+	order := cfg.BandpassOrder
+	if order < 1 {
+		order = 1
+	}
+	if cfg.BandpassLow > 0 {
+		for i := 0; i < order; i++ {
+			bq := HighpassCoeffs(cfg.BandpassLow, defaultQ, sampleRate)
+			stages = append(stages, &bq)
+		}
+	}
+	if cfg.BandpassHigh > 0 {
+		for i := 0; i < order; i++ {
+			bq := LowpassCoeffs(cfg.BandpassHigh, defaultQ, sampleRate)
+			stages = append(stages, &bq)
+		}
+	}
+
+	return &Chain{stages: stages}
+}
+
+// Process runs x through every stage in the cascade.
+func (c *Chain) Process(x float64) float64 {
+	for _, stage := range c.stages {
+		x = stage.Process(x)
+	}
+	return x
+}
+
+// Filter applies the configured notch + bandpass chain to every channel of
+// each Sample that passes through it, keeping persistent per-channel filter
+// state between calls.
+type Filter struct {
+	mu     sync.Mutex
+	chains [NumFilterChannels]*Chain
+}
+
+// NumFilterChannels is the number of per-channel filter chains a Filter
+// maintains; it matches settings.NumChannels.
+const NumFilterChannels = settings.NumChannels
+
+// NewFilter builds a Filter from the given configuration.
+func NewFilter(cfg settings.FilterConfig, sampleRate float64) *Filter {
+	f := &Filter{}
+	for ch := range f.chains {
+		f.chains[ch] = NewChain(cfg, sampleRate)
+	}
+	return f
+}
+
+// Reconfigure atomically swaps in a new filter configuration, resetting all
+// per-channel state so coefficients from the old configuration can't leak
+// into the new response.
+func (f *Filter) Reconfigure(cfg settings.FilterConfig, sampleRate float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.chains {
+		f.chains[ch] = NewChain(cfg, sampleRate)
+	}
+}
+
+// Process runs the filter chain over every channel of s and returns the
+// filtered sample.
+func (f *Filter) Process(s Sample) Sample {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var out Sample
+	for ch := 0; ch < len(f.chains); ch++ {
+		out.Channels[ch] = int32(f.chains[ch].Process(float64(s.Channels[ch])))
+	}
+	return out
+}
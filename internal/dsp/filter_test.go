@@ -0,0 +1,84 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/PrunesLand/eeg-server.git/internal/settings"
+)
+
+// rms returns the root-mean-square of samples, ignoring the first skip of
+// them so filter startup transients don't skew the measurement.
+func rms(samples []float64, skip int) float64 {
+	var sum float64
+	n := 0
+	for i, x := range samples {
+		if i < skip {
+			continue
+		}
+		sum += x * x
+		n++
+	}
+	return math.Sqrt(sum / float64(n))
+}
+
+func sineWave(freq, sampleRate float64, n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.Sin(2 * math.Pi * freq * float64(i) / sampleRate)
+	}
+	return out
+}
+
+func TestNotchCoeffsAttenuatesTargetFrequency(t *testing.T) {
+	const sampleRate = 250.0
+	bq := NotchCoeffs(50, 30, sampleRate)
+
+	in := sineWave(50, sampleRate, 2000)
+	out := make([]float64, len(in))
+	for i, x := range in {
+		out[i] = bq.Process(x)
+	}
+
+	inRMS := rms(in, 500)
+	outRMS := rms(out, 500)
+	if outRMS > inRMS*0.1 {
+		t.Fatalf("notch at 50Hz barely attenuated a 50Hz tone: in RMS %.4f, out RMS %.4f", inRMS, outRMS)
+	}
+}
+
+func TestNotchCoeffsPassesOtherFrequencies(t *testing.T) {
+	const sampleRate = 250.0
+	bq := NotchCoeffs(50, 30, sampleRate)
+
+	in := sineWave(10, sampleRate, 2000)
+	out := make([]float64, len(in))
+	for i, x := range in {
+		out[i] = bq.Process(x)
+	}
+
+	inRMS := rms(in, 500)
+	outRMS := rms(out, 500)
+	if outRMS < inRMS*0.9 {
+		t.Fatalf("notch at 50Hz over-attenuated a 10Hz tone: in RMS %.4f, out RMS %.4f", inRMS, outRMS)
+	}
+}
+
+func TestFilterReconfigureResetsState(t *testing.T) {
+	cfg := settings.FilterConfig{NotchFreq: 50, NotchQ: 30, BandpassLow: 1, BandpassHigh: 45, BandpassOrder: 2}
+	f := NewFilter(cfg, 250)
+
+	for i := 0; i < 100; i++ {
+		f.Process(Sample{Channels: [8]int32{1: 1000000}})
+	}
+
+	f.Reconfigure(cfg, 250)
+
+	for ch, chain := range f.chains {
+		for _, stage := range chain.stages {
+			if stage.z1 != 0 || stage.z2 != 0 {
+				t.Fatalf("channel %d stage state not reset after Reconfigure: z1=%v z2=%v", ch, stage.z1, stage.z2)
+			}
+		}
+	}
+}
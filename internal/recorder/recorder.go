@@ -0,0 +1,213 @@
+// Package recorder subscribes to a dsp.Hub and writes each session to disk
+// with automatic daily rotation, so a capture can be replayed later through
+// serial.PortReplay or analyzed offline.
+package recorder
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PrunesLand/eeg-server.git/internal/dsp"
+)
+
+// Format selects the on-disk layout for a recording.
+type Format string
+
+const (
+	// FormatBinary is the compact append-only framing (see dsp.WriteBinaryHeader
+	// / dsp.WriteBinarySample) that serial.PortReplay reads back.
+	FormatBinary Format = "bin"
+	// FormatCSV is a plain CSV export (timestamp + one volts column per
+	// channel) for offline analysis in tools like MNE. It is not a lossless
+	// format and cannot be replayed through serial.PortReplay.
+	FormatCSV Format = "csv"
+)
+
+// Recorder subscribes to a dsp.Hub and writes every sample to a
+// daily-rotated file on disk until Stop is called.
+type Recorder struct {
+	hub    *dsp.Hub
+	dir    string
+	format Format
+	gain   func() float64
+
+	mu          sync.Mutex
+	recording   bool
+	unsubscribe func()
+	done        chan struct{} // closed by run() once it has drained samples
+	file        *os.File
+	writer      *bufio.Writer
+	day         string // UTC "20060102" of the currently open file
+}
+
+// New creates a Recorder that writes recordings under dir in the given
+// format. gain is read once per file rotation to stamp the binary header.
+func New(hub *dsp.Hub, dir string, format Format, gain func() float64) *Recorder {
+	return &Recorder{hub: hub, dir: dir, format: format, gain: gain}
+}
+
+// Start begins recording in the background. It is an error to call Start
+// while a recording is already in progress.
+func (r *Recorder) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.recording {
+		return fmt.Errorf("recorder: already recording")
+	}
+
+	samples, unsubscribe := r.hub.Subscribe(64)
+	done := make(chan struct{})
+	r.unsubscribe = unsubscribe
+	r.recording = true
+	r.done = done
+
+	go r.run(samples, done)
+	return nil
+}
+
+// Stop ends the current recording and closes the file. It is an error to
+// call Stop when no recording is in progress.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	if !r.recording {
+		r.mu.Unlock()
+		return fmt.Errorf("recorder: not recording")
+	}
+	r.unsubscribe()
+	r.recording = false
+	done := r.done
+	r.mu.Unlock()
+
+	// Wait for run() to finish draining whatever was already buffered in
+	// the subscriber channel before closing the file. Without this, a
+	// trailing write can land after closeLocked, reopening the file we
+	// just considered closed.
+	<-done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closeLocked()
+}
+
+// Status reports whether a recording is in progress and, if so, the path it
+// is currently writing to.
+func (r *Recorder) Status() (recording bool, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return r.recording, ""
+	}
+	return r.recording, r.file.Name()
+}
+
+func (r *Recorder) run(samples <-chan dsp.Sample, done chan<- struct{}) {
+	defer close(done)
+	for sample := range samples {
+		if err := r.write(sample); err != nil {
+			log.Printf("⚠️ Recorder write error: %v", err)
+		}
+	}
+}
+
+func (r *Recorder) write(sample dsp.Sample) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	if err := r.rotateIfNeededLocked(now); err != nil {
+		return err
+	}
+
+	switch r.format {
+	case FormatBinary:
+		if err := dsp.WriteBinarySample(r.writer, sample); err != nil {
+			return err
+		}
+	default:
+		gain := r.gain()
+		fields := make([]string, 0, 9)
+		fields = append(fields, now.Format(time.RFC3339Nano))
+		for ch := 0; ch < 8; ch++ {
+			fields = append(fields, fmt.Sprintf("%.6f", dsp.Volts(sample.Channels[ch], gain)))
+		}
+		if _, err := fmt.Fprintln(r.writer, strings.Join(fields, ",")); err != nil {
+			return err
+		}
+	}
+
+	return r.writer.Flush()
+}
+
+// rotateIfNeededLocked opens (or reopens) the file for the current UTC date
+// if it isn't already open. r.mu must be held.
+func (r *Recorder) rotateIfNeededLocked(now time.Time) error {
+	day := now.Format("20060102")
+	if day == r.day && r.file != nil {
+		return nil
+	}
+
+	if err := r.closeLocked(); err != nil {
+		return err
+	}
+
+	yearDir := filepath.Join(r.dir, now.Format("2006"))
+	if err := os.MkdirAll(yearDir, 0o755); err != nil {
+		return fmt.Errorf("recorder: create directory: %w", err)
+	}
+
+	path := filepath.Join(yearDir, day+"."+string(r.format))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("recorder: open %s: %w", path, err)
+	}
+
+	info, statErr := f.Stat()
+	isNewFile := statErr == nil && info.Size() == 0
+
+	r.file = f
+	r.writer = bufio.NewWriter(f)
+	r.day = day
+
+	if isNewFile {
+		if err := r.writeFileHeaderLocked(); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("💾 Recording to %s", path)
+	return nil
+}
+
+func (r *Recorder) writeFileHeaderLocked() error {
+	switch r.format {
+	case FormatBinary:
+		return dsp.WriteBinaryHeader(r.writer, r.gain())
+	case FormatCSV:
+		_, err := fmt.Fprintln(r.writer, "timestamp,ch1,ch2,ch3,ch4,ch5,ch6,ch7,ch8")
+		return err
+	}
+	return nil
+}
+
+func (r *Recorder) closeLocked() error {
+	if r.writer != nil {
+		if err := r.writer.Flush(); err != nil {
+			return err
+		}
+	}
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+	}
+	r.file = nil
+	r.writer = nil
+	return nil
+}
@@ -0,0 +1,83 @@
+package recorder
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PrunesLand/eeg-server.git/internal/dsp"
+)
+
+func TestStopClosesFileBeforeReturning(t *testing.T) {
+	dir := t.TempDir()
+	hub := dsp.NewHub()
+	rec := New(hub, dir, FormatBinary, func() float64 { return 4.0 })
+
+	in := make(chan [][]byte, 1)
+	go hub.Run(in, nil, nil)
+
+	if err := rec.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	packet := dsp.Encode(dsp.Sample{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case in <- [][]byte{packet}:
+			}
+		}
+	}()
+
+	// Give the flood a moment to fill the subscriber buffer, then stop
+	// while samples are still in flight, matching how the server's
+	// /api/recording/stop handler races a live stream.
+	time.Sleep(10 * time.Millisecond)
+
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	close(stop)
+	<-done
+
+	_, path := rec.Status()
+	if path != "" {
+		t.Fatalf("Status reported a file path after Stop: %s", path)
+	}
+
+	recording, path := rec.Status()
+	if recording {
+		t.Fatalf("Status reports still recording after Stop")
+	}
+
+	// The file Stop closed must not grow afterward: find it on disk and
+	// make sure its size doesn't change once we let the flood finish.
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		t.Fatalf("expected a year directory under %s, got %v (err=%v)", dir, entries, err)
+	}
+	yearDir := dir + "/" + entries[0].Name()
+	files, err := os.ReadDir(yearDir)
+	if err != nil || len(files) == 0 {
+		t.Fatalf("expected a recording file under %s, got %v (err=%v)", yearDir, files, err)
+	}
+	filePath := yearDir + "/" + files[0].Name()
+
+	before, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("stat %s: %v", filePath, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	after, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("stat %s: %v", filePath, err)
+	}
+	if after.Size() != before.Size() {
+		t.Fatalf("file grew after Stop returned: %d -> %d bytes", before.Size(), after.Size())
+	}
+}
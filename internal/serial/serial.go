@@ -3,36 +3,167 @@ package serial
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"os"
 
 	"math"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.bug.st/serial"
+
+	"github.com/PrunesLand/eeg-server.git/internal/dsp"
 )
 
 // PortMock is a special port name that triggers the mock data generator.
 const PortMock = "MOCK"
 
+// PortReplay is a special port name that replays a previously recorded
+// binary session file (see internal/recorder) through the Device interface
+// instead of talking to real hardware. Set Device.ReplayFile (and,
+// optionally, Device.ReplaySpeed) before calling Start.
+const PortReplay = "REPLAY"
+
+const (
+	packetSize = 25
+
+	// maxBatchPackets bounds how many complete frames readLoop will drain
+	// from packetBuf and hand off in a single DataStream send.
+	maxBatchPackets = 32
+
+	initialReconnectBackoff = 500 * time.Millisecond
+	maxReconnectBackoff     = 30 * time.Second
+)
+
+// ConnState describes the current connection state of a Device.
+type ConnState int
+
+const (
+	StateDisconnected ConnState = iota
+	StateConnected
+	StateReconnecting
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	default:
+		return "disconnected"
+	}
+}
+
 // Device represents your USB EEG hardware.
 type Device struct {
 	PortName string
 	BaudRate int
-	// Output: A channel where we will push raw data chunks.
-	// Other parts of your app (DSP) will listen to this.
-	DataStream chan []byte
+	// Output: a channel of packet batches. Each batch holds every complete
+	// 25-byte frame that was available at the time of one underlying read,
+	// so downstream consumers (DSP/WS/console) iterate a batch without
+	// re-entering the scheduler per sample.
+	DataStream chan [][]byte
+
+	// ReplayFile and ReplaySpeed only apply when PortName == PortReplay.
+	ReplayFile  string
+	ReplaySpeed float64 // 1.0 = real-time; <= 0 is treated as 1.0
+
+	droppedBatches uint64
+	batchPool      sync.Pool
+
+	stateMu      sync.RWMutex
+	currentState ConnState
+	currentPort  string
 }
 
 // New creates a new Device instance.
 func New(port string, baud int) *Device {
-	return &Device{
+	d := &Device{
 		PortName: port,
 		BaudRate: baud,
 		// Buffer the channel to 100 slots.
 		// If the DSP falls slightly behind, the Serial reader won't block immediately.
-		DataStream: make(chan []byte, 100),
+		DataStream: make(chan [][]byte, 100),
+	}
+	d.batchPool.New = func() interface{} {
+		slab := make([][]byte, 0, maxBatchPackets)
+		return &slab
 	}
+	return d
+}
+
+// CurrentState reports the device's current connection state.
+func (d *Device) CurrentState() ConnState {
+	d.stateMu.RLock()
+	defer d.stateMu.RUnlock()
+	return d.currentState
+}
+
+// CurrentPort reports the port path the device is (or was last) connected
+// to. It can differ from PortName once a reconnect has rediscovered the
+// device on a new path.
+func (d *Device) CurrentPort() string {
+	d.stateMu.RLock()
+	defer d.stateMu.RUnlock()
+	return d.currentPort
+}
+
+// setState records a connection-state transition. Callers observe it via the
+// poll-based CurrentState/CurrentPort accessors (used by e.g. /api/device).
+func (d *Device) setState(state ConnState, port string) {
+	d.stateMu.Lock()
+	d.currentState = state
+	d.currentPort = port
+	d.stateMu.Unlock()
+}
+
+// BatchSize returns the maximum number of packets delivered in a single
+// DataStream batch. Mock and replay modes always deliver one packet at a
+// time.
+func (d *Device) BatchSize() int {
+	if d.PortName == PortMock || d.PortName == PortReplay {
+		return 1
+	}
+	return maxBatchPackets
+}
+
+// DroppedBatches returns the number of batches dropped because a consumer
+// wasn't keeping up with DataStream, since the device started.
+func (d *Device) DroppedBatches() uint64 {
+	return atomic.LoadUint64(&d.droppedBatches)
+}
+
+// ReadBatch pulls the next available batch from DataStream into dst and
+// returns how many packets were copied, as an alternative to ranging over
+// DataStream directly. It blocks until a batch is available or the stream
+// closes, in which case it returns io.EOF. The returned batch is released
+// back to the pool before ReadBatch returns, so dst must be sized to hold
+// up to BatchSize() packets.
+func (d *Device) ReadBatch(dst [][]byte) (n int, err error) {
+	batch, ok := <-d.DataStream
+	if !ok {
+		return 0, io.EOF
+	}
+	n = copy(dst, batch)
+	d.ReleaseBatch(batch)
+	return n, nil
+}
+
+// ReleaseBatch returns a batch obtained from DataStream (or ReadBatch) to the
+// pool so its backing array can be reused. Callers must not use batch after
+// calling this.
+func (d *Device) ReleaseBatch(batch [][]byte) {
+	batch = batch[:0]
+	d.batchPool.Put(&batch)
+}
+
+func (d *Device) getBatch() [][]byte {
+	slab := d.batchPool.Get().(*[][]byte)
+	return (*slab)[:0]
 }
 
 // Start opens the connection and starts the background reading loop.
@@ -41,33 +172,116 @@ func (d *Device) Start(ctx context.Context) error {
 	// SPECIAL CASE: Mock Mode
 	if d.PortName == PortMock {
 		go d.mockLoop(ctx)
+		d.setState(StateConnected, PortMock)
 		return nil
 	}
 
-	mode := &serial.Mode{
-		BaudRate: d.BaudRate,
+	// SPECIAL CASE: Replay Mode
+	if d.PortName == PortReplay {
+		return d.startReplay(ctx)
+	}
+
+	// Real hardware: hand off to a supervisor that keeps retrying (with
+	// backoff) across unplug/replug events instead of giving up on the
+	// first read error.
+	go d.supervise(ctx)
+
+	return nil
+}
+
+// supervise keeps the device connected for as long as ctx is alive,
+// transparently reconnecting with exponential backoff whenever the port
+// disappears (e.g. the USB cable is unplugged) instead of exiting
+// permanently like a one-shot open+readLoop would.
+func (d *Device) supervise(ctx context.Context) {
+	defer close(d.DataStream)
+
+	backoff := initialReconnectBackoff
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		port, opened, err := d.openPort()
+		if err != nil {
+			d.setState(StateReconnecting, "")
+			log.Printf("🔌 Waiting for device to reappear: %v", err)
+			if !sleepOrDone(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+
+		backoff = initialReconnectBackoff
+		d.setState(StateConnected, opened)
+
+		// Blocks until ctx is cancelled or the port errors out (e.g. unplug).
+		d.readLoop(ctx, port, opened)
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			d.setState(StateDisconnected, "")
+		}
+	}
+}
+
+// openPort tries PortName first, then falls back to rediscovering a
+// preferred port, since a USB re-enumeration can assign the device a new
+// path after it reappears.
+func (d *Device) openPort() (port serial.Port, openedPort string, err error) {
+	mode := &serial.Mode{BaudRate: d.BaudRate}
+
+	if port, err := serial.Open(d.PortName, mode); err == nil {
+		return port, d.PortName, nil
 	}
 
-	// 1. Open the Port
-	port, err := serial.Open(d.PortName, mode)
+	ports, err := ListPorts()
 	if err != nil {
-		return fmt.Errorf("failed to open port %s: %w", d.PortName, err)
+		return nil, "", err
 	}
 
-	// 2. Start the Reader Goroutine
-	// This runs in the background forever until the app stops.
-	go d.readLoop(ctx, port)
+	candidate := FindPreferredPort(ports)
+	if candidate == "" {
+		return nil, "", fmt.Errorf("no serial port available")
+	}
 
-	return nil
+	port, err = serial.Open(candidate, mode)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open port %s: %w", candidate, err)
+	}
+	return port, candidate, nil
+}
+
+func sleepOrDone(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func nextBackoff(b time.Duration) time.Duration {
+	b *= 2
+	if b > maxReconnectBackoff {
+		return maxReconnectBackoff
+	}
+	return b
 }
 
-// readLoop handles the continuous reading of bytes and framing packets.
-func (d *Device) readLoop(ctx context.Context, port serial.Port) {
-	// Ensure we close the port and the channel when this loop exits
+// readLoop handles the continuous reading of bytes and framing packets for
+// one connection. It returns (without closing DataStream, which outlives
+// individual connections) on cancellation or on a read error.
+func (d *Device) readLoop(ctx context.Context, port serial.Port, portName string) {
+	// Ensure we close the port when this connection ends.
 	defer port.Close()
-	defer close(d.DataStream)
 
-	log.Printf("🔌 Serial Connected: %s @ %d baud", d.PortName, d.BaudRate)
+	log.Printf("🔌 Serial Connected: %s @ %d baud", portName, d.BaudRate)
 
 	// Buffer for raw reads
 	readBuf := make([]byte, 1024)
@@ -90,47 +304,65 @@ func (d *Device) readLoop(ctx context.Context, port serial.Port) {
 			return
 		}
 
-		if n > 0 {
-			// Append new bytes to accumulator
-			packetBuf = append(packetBuf, readBuf[:n]...)
-
-			// Process accumulator for valid packets
-			// Protocol: 25 bytes total. Byte 0 is 'A' (0x41).
-			for len(packetBuf) >= 25 {
-				// Find start byte 'A'
-				if packetBuf[0] != 'A' {
-					// Discard byte (slide window) until we find 'A' or run out
-					packetBuf = packetBuf[1:]
-					continue
-				}
-
-				// We have 'A' at index 0. Check if we have enough bytes for a full frame.
-				if len(packetBuf) < 25 {
-					// Not enough yet, wait for more data
-					break
-				}
-
-				// Full packet found! Extract 25 bytes.
-				fullPacket := make([]byte, 25)
-				copy(fullPacket, packetBuf[:25])
-
-				// Advance accumulator
-				packetBuf = packetBuf[25:]
-
-				// Send to DSP
-				select {
-				case d.DataStream <- fullPacket:
-				default:
-					log.Println("⚠️ Warning: DSP buffer full, dropping packet")
-				}
-			}
+		if n == 0 {
+			continue
+		}
+
+		// Append new bytes to accumulator
+		packetBuf = append(packetBuf, readBuf[:n]...)
+
+		// Drain every complete frame currently sitting in packetBuf into one
+		// batch, so the consumer gets them in a single send instead of one
+		// per packet.
+		batch := d.getBatch()
+		packetBuf, batch = drainFrames(packetBuf, batch)
+
+		if len(batch) == 0 {
+			d.releaseEmptyBatch(batch)
+			continue
+		}
+
+		// Send the whole batch to consumers in one go.
+		select {
+		case d.DataStream <- batch:
+		default:
+			atomic.AddUint64(&d.droppedBatches, 1)
+			log.Println("⚠️ Warning: DSP buffer full, dropping batch")
+			d.releaseEmptyBatch(batch)
 		}
 	}
 }
 
+// drainFrames scans buf for complete, 'A'-prefixed packetSize frames,
+// appending each one to batch (up to maxBatchPackets total across the calls
+// that built batch) and discarding any leading bytes that don't start a
+// frame. It returns the unconsumed remainder of buf and the extended batch.
+func drainFrames(buf []byte, batch [][]byte) (remaining []byte, out [][]byte) {
+	for len(buf) >= packetSize && len(batch) < maxBatchPackets {
+		if buf[0] != 'A' {
+			buf = buf[1:]
+			continue
+		}
+
+		packet := make([]byte, packetSize)
+		copy(packet, buf[:packetSize])
+		buf = buf[packetSize:]
+
+		batch = append(batch, packet)
+	}
+	return buf, batch
+}
+
+// releaseEmptyBatch returns a batch that was never sent on DataStream back
+// to the pool.
+func (d *Device) releaseEmptyBatch(batch [][]byte) {
+	d.batchPool.Put(&batch)
+}
+
 // mockLoop generates synthetic data to simulate a device.
 func (d *Device) mockLoop(ctx context.Context) {
 	defer close(d.DataStream)
+	defer d.setState(StateDisconnected, "")
 	log.Printf("🔮 Mock Mode Started: Generating synthetic signals...")
 
 	ticker := time.NewTicker(4 * time.Millisecond) // ~250Hz
@@ -143,32 +375,83 @@ func (d *Device) mockLoop(ctx context.Context) {
 			log.Println("🔮 Stopping Mock Reader...")
 			return
 		case <-ticker.C:
-			// Frame: [ 'A' ] [ 3-byte Ch1 ] [ 3-byte Ch2 ] ... [ 3-byte Ch8 ]
-			// Total 1 + 24 = 25 bytes.
-			// Format: Big Endian Signed 24-bit.
-			packet := make([]byte, 25)
-			packet[0] = 'A'
-
-			// Generate 8 channels of data
-			// We'll vary phases/frequencies slightly so channels look different
+			// Generate 8 channels of data.
+			// We'll vary phases/frequencies slightly so channels look different.
+			var sample dsp.Sample
 			for ch := 0; ch < 8; ch++ {
 				// Sine wave: amplitude ~8 million (full 24-bit range is +/- 8.3M)
 				// Offset phases by channel index to look cool
 				valFloat := 8000000 * math.Sin(t+float64(ch))
-				valInt := int32(valFloat)
-
-				// Encode 24-bit Big Endian
-				// B0 is MSB, B2 is LSB
-				startIndex := 1 + (ch * 3)
-				packet[startIndex] = byte((valInt >> 16) & 0xFF)
-				packet[startIndex+1] = byte((valInt >> 8) & 0xFF)
-				packet[startIndex+2] = byte(valInt & 0xFF)
+				sample.Channels[ch] = int32(valFloat)
 			}
 			t += 0.1
 
+			// Mock mode preserves single-packet semantics: BatchSize() is 1.
+			select {
+			case d.DataStream <- [][]byte{dsp.Encode(sample)}:
+			default:
+				atomic.AddUint64(&d.droppedBatches, 1)
+			}
+		}
+	}
+}
+
+// startReplay opens d.ReplayFile and kicks off a goroutine that feeds its
+// recorded samples back through DataStream at (roughly) the speed they were
+// captured.
+func (d *Device) startReplay(ctx context.Context) error {
+	f, err := os.Open(d.ReplayFile)
+	if err != nil {
+		return fmt.Errorf("failed to open replay file %s: %w", d.ReplayFile, err)
+	}
+
+	gain, err := dsp.ReadBinaryHeader(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to read replay header: %w", err)
+	}
+	log.Printf("⏪ Replaying %s (recorded at gain %.2f)", d.ReplayFile, gain)
+	d.setState(StateConnected, d.ReplayFile)
+
+	go d.replayLoop(ctx, f)
+	return nil
+}
+
+// replayLoop reads samples back from a recorded binary file and re-encodes
+// them into wire packets on DataStream, one per tick, like mockLoop.
+func (d *Device) replayLoop(ctx context.Context, f *os.File) {
+	defer f.Close()
+	defer close(d.DataStream)
+	defer d.setState(StateDisconnected, "")
+
+	speed := d.ReplaySpeed
+	if speed <= 0 {
+		speed = 1.0
+	}
+
+	const nominalRate = 250 // Hz, matches the real device's sample rate
+	interval := time.Duration(float64(time.Second) / nominalRate / speed)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("⏪ Stopping replay...")
+			return
+		case <-ticker.C:
+			sample, err := dsp.ReadBinarySample(f)
+			if err != nil {
+				log.Printf("⏪ Replay finished: %v", err)
+				return
+			}
+
+			// Replay preserves single-packet semantics: BatchSize() is 1.
 			select {
-			case d.DataStream <- packet:
+			case d.DataStream <- [][]byte{dsp.Encode(sample)}:
 			default:
+				atomic.AddUint64(&d.droppedBatches, 1)
 			}
 		}
 	}
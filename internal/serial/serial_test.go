@@ -0,0 +1,74 @@
+package serial
+
+import (
+	"bytes"
+	"testing"
+)
+
+func frame(n byte) []byte {
+	f := make([]byte, packetSize)
+	f[0] = 'A'
+	f[1] = n // arbitrary payload byte so frames are distinguishable
+	return f
+}
+
+func TestDrainFramesExtractsCompleteFrames(t *testing.T) {
+	var buf []byte
+	buf = append(buf, frame(1)...)
+	buf = append(buf, frame(2)...)
+	buf = append(buf, []byte{'A', 0x00}...) // trailing partial frame
+
+	remaining, batch := drainFrames(buf, nil)
+
+	if len(batch) != 2 {
+		t.Fatalf("got %d frames, want 2", len(batch))
+	}
+	if batch[0][1] != 1 || batch[1][1] != 2 {
+		t.Fatalf("frames out of order or corrupted: %v", batch)
+	}
+	if len(remaining) != 2 || remaining[0] != 'A' {
+		t.Fatalf("partial trailing frame not preserved, got %v", remaining)
+	}
+}
+
+func TestDrainFramesSkipsGarbageBeforeStartByte(t *testing.T) {
+	buf := append([]byte{0xFF, 0xFF, 0xFF}, frame(7)...)
+
+	remaining, batch := drainFrames(buf, nil)
+
+	if len(remaining) != 0 {
+		t.Fatalf("expected no remainder, got %v", remaining)
+	}
+	if len(batch) != 1 || batch[0][1] != 7 {
+		t.Fatalf("expected one frame recovered after garbage, got %v", batch)
+	}
+}
+
+func TestDrainFramesCapsAtMaxBatchPackets(t *testing.T) {
+	var buf []byte
+	for i := 0; i < maxBatchPackets+5; i++ {
+		buf = append(buf, frame(byte(i))...)
+	}
+
+	remaining, batch := drainFrames(buf, nil)
+
+	if len(batch) != maxBatchPackets {
+		t.Fatalf("got %d frames, want %d (maxBatchPackets)", len(batch), maxBatchPackets)
+	}
+	if len(remaining) != 5*packetSize {
+		t.Fatalf("expected %d leftover bytes, got %d", 5*packetSize, len(remaining))
+	}
+}
+
+func TestDrainFramesAppendsToExistingBatch(t *testing.T) {
+	existing := [][]byte{frame(0)}
+
+	_, batch := drainFrames(frame(1), existing)
+
+	if len(batch) != 2 {
+		t.Fatalf("got %d frames, want 2", len(batch))
+	}
+	if !bytes.Equal(batch[0], existing[0]) {
+		t.Fatalf("existing batch entry was mutated")
+	}
+}
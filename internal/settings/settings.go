@@ -2,29 +2,100 @@ package settings
 
 import "sync"
 
+// NumChannels is the number of ADC channels the device exposes.
+const NumChannels = 8
+
+// FilterConfig configures the DSP filter chain applied to every channel: a
+// mains-hum notch followed by a bandpass, both implemented as biquad
+// cascades in internal/dsp.
+type FilterConfig struct {
+	// NotchFreq is the mains-hum notch center frequency in Hz (50 or 60).
+	// 0 disables the notch.
+	NotchFreq float64 `json:"notchFreq"`
+	// NotchQ is the notch's quality factor; higher values narrow the notch.
+	NotchQ float64 `json:"notchQ"`
+
+	// BandpassLow/BandpassHigh are the -3dB bandpass cutoff frequencies in
+	// Hz. Either can be 0 to disable that side of the bandpass.
+	BandpassLow  float64 `json:"bandpassLow"`
+	BandpassHigh float64 `json:"bandpassHigh"`
+	// BandpassOrder is the number of cascaded biquad sections per side.
+	BandpassOrder int `json:"bandpassOrder"`
+}
+
+// Config is the full structured, JSON-serializable DSP/server configuration.
+type Config struct {
+	// SampleRate is the device's sampling rate in Hz; filter coefficients
+	// are computed against it.
+	SampleRate float64 `json:"sampleRate"`
+	// ChannelGain is a per-channel gain divisor, index 0 to NumChannels-1.
+	ChannelGain [NumChannels]float64 `json:"channelGain"`
+	// ChannelEnable masks which channels are active, index 0 to NumChannels-1.
+	ChannelEnable [NumChannels]bool `json:"channelEnable"`
+	Filter        FilterConfig      `json:"filter"`
+}
+
 // Settings holds the dynamic configuration of the server.
 type Settings struct {
-	mu   sync.RWMutex
-	gain float64
+	mu     sync.RWMutex
+	config Config
 }
 
-// New creates a new Settings instance with defaults.
+// New creates a new Settings instance with defaults: gain 4.0 and all
+// channels enabled, a 50Hz notch, and a 1-45Hz bandpass at 250Hz.
 func New() *Settings {
-	return &Settings{
-		gain: 4.0, // Default Gain
+	s := &Settings{
+		config: Config{
+			SampleRate: 250,
+			Filter: FilterConfig{
+				NotchFreq:     50,
+				NotchQ:        30,
+				BandpassLow:   1,
+				BandpassHigh:  45,
+				BandpassOrder: 2,
+			},
+		},
+	}
+	for ch := 0; ch < NumChannels; ch++ {
+		s.config.ChannelGain[ch] = 4.0 // Default Gain
+		s.config.ChannelEnable[ch] = true
 	}
+	return s
 }
 
-// GetGain safely returns the current gain.
+// GetGain safely returns the master gain (channel 0's gain), for callers
+// that don't care about per-channel tuning.
 func (s *Settings) GetGain() float64 {
+	return s.GetChannelGain(0)
+}
+
+// SetGain safely sets the gain uniformly across every channel. Use
+// SetConfig for per-channel control.
+func (s *Settings) SetGain(g float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.config.ChannelGain {
+		s.config.ChannelGain[ch] = g
+	}
+}
+
+// GetChannelGain safely returns the gain for a single channel.
+func (s *Settings) GetChannelGain(ch int) float64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.gain
+	return s.config.ChannelGain[ch]
 }
 
-// SetGain safely updates the gain.
-func (s *Settings) SetGain(g float64) {
+// GetConfig safely returns a copy of the full configuration.
+func (s *Settings) GetConfig() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// SetConfig atomically swaps in a new configuration.
+func (s *Settings) SetConfig(c Config) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.gain = g
+	s.config = c
 }